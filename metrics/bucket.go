@@ -0,0 +1,94 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+)
+
+/*
+A Bucket is a container that accumulates a single range's worth of a
+Histogram's observations and exposes summary statistics about them.
+*/
+type Bucket interface {
+	// Add records value's occurrence in this bucket.
+	Add(value float64)
+	// Observations reports how many values have been recorded.
+	Observations() int
+	// Reset clears all recorded observations.
+	Reset()
+	// String produces a human-consumable representation of the bucket.
+	String() string
+	// ValueForIndex returns the value at the given position among the
+	// bucket's retained, sorted observations.
+	ValueForIndex(index int) float64
+}
+
+/*
+A BucketBuilder manufactures Buckets for a Histogram: one per distinct
+label set per entry in HistogramSpecification.Starts.
+*/
+type BucketBuilder func() Bucket
+
+/*
+AccumulatingBucket is a Bucket that retains every observation in sorted
+order and answers ValueForIndex with a direct positional lookup.  This is
+the straightforward bucket implementation bucketForPercentile estimates
+percentiles against by picking positional elements out of caller-supplied
+bucketStarts.
+*/
+type AccumulatingBucket struct {
+	values []float64
+}
+
+/*
+NewAccumulatingBucket produces an empty AccumulatingBucket.
+*/
+func NewAccumulatingBucket() *AccumulatingBucket {
+	return &AccumulatingBucket{}
+}
+
+/*
+AccumulatingBucketBuilder produces a BucketBuilder that yields
+AccumulatingBuckets.
+*/
+func AccumulatingBucketBuilder() BucketBuilder {
+	return func() Bucket {
+		return NewAccumulatingBucket()
+	}
+}
+
+func (b *AccumulatingBucket) Add(value float64) {
+	i := sort.Search(len(b.values), func(i int) bool { return b.values[i] >= value })
+
+	b.values = append(b.values, 0)
+	copy(b.values[i+1:], b.values[i:])
+	b.values[i] = value
+}
+
+func (b *AccumulatingBucket) Observations() int {
+	return len(b.values)
+}
+
+func (b *AccumulatingBucket) Reset() {
+	b.values = nil
+}
+
+func (b *AccumulatingBucket) String() string {
+	return fmt.Sprintf("[AccumulatingBucket with %d observations]", len(b.values))
+}
+
+func (b *AccumulatingBucket) ValueForIndex(index int) float64 {
+	if index < 0 || index >= len(b.values) {
+		return 0
+	}
+
+	return b.values[index]
+}
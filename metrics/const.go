@@ -0,0 +1,27 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+// These are the keys and type tags used in the JSON-consumable
+// representations produced by AsMarshallable.
+const (
+	typeKey   = "type"
+	labelsKey = "labels"
+	valueKey  = "value"
+
+	histogramTypeValue = "histogram"
+)
+
+// These control how floating-point values are rendered across the
+// package; see strconv.FormatFloat.
+const (
+	floatFormat    = 'g'
+	floatPrecision = -1
+	floatBitCount  = 64
+)
@@ -0,0 +1,283 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+/*
+An ExemplarBucket is a Bucket that can additionally retain an exemplar —
+an out-of-band label set such as a trace ID — alongside an observation.
+Histogram.AddWithExemplar prefers this over plain Bucket.Add when the
+target bucket supports it.
+*/
+type ExemplarBucket interface {
+	Bucket
+	AddWithExemplar(value float64, exemplarLabels map[string]string)
+}
+
+/*
+An exemplarRetriever is an ExemplarBucket whose exemplars are addressable
+by position, mirroring Bucket.ValueForIndex; histogram.Exemplar consults
+this for buckets reached through the positional bucketForPercentile path.
+*/
+type exemplarRetriever interface {
+	Exemplar(index int) map[string]string
+}
+
+/*
+An exemplarQuerier is an ExemplarBucket that can return the exemplar
+behind a percentile directly, mirroring quantileQuerier for buckets whose
+observations aren't addressable by position; histogram.Exemplar consults
+this for the single-bucket quantileQuerier short-circuit.
+*/
+type exemplarQuerier interface {
+	ExemplarForPercentile(percentile float64) map[string]string
+}
+
+/*
+A decayingSample is one observation retained by a DecayingBucket: its
+value, its exponentially-decaying weight, the time that weight was last
+brought up to date (initially the time it was recorded), and an optional
+exemplar.
+*/
+type decayingSample struct {
+	value     float64
+	weight    float64
+	timestamp time.Time
+	exemplar  map[string]string
+}
+
+/*
+defaultDecayingBucketMaxSamples bounds how many observations a
+DecayingBucket retains at once.  Without a bound, a long-running
+process — the exact use case this bucket targets — would grow the
+sample set forever, since decay only drives a sample's weight toward
+zero rather than removing it.
+*/
+const defaultDecayingBucketMaxSamples = 1000
+
+/*
+DecayingBucket is a Bucket whose observations' contributions to
+percentile queries decay exponentially over a configurable half-life, so
+that long-running processes report percentiles reflecting recent
+behavior rather than the lifetime of the process.  It is meant to be the
+sole bucket behind a Histogram; see NewDecayingHistogram.
+*/
+type DecayingBucket struct {
+	halfLife   time.Duration
+	maxSamples int
+	samples    []decayingSample
+}
+
+/*
+NewDecayingBucket constructs a DecayingBucket whose samples' weights are
+halved every halfLife, retaining at most defaultDecayingBucketMaxSamples
+observations at a time.
+*/
+func NewDecayingBucket(halfLife time.Duration) *DecayingBucket {
+	return &DecayingBucket{halfLife: halfLife, maxSamples: defaultDecayingBucketMaxSamples}
+}
+
+/*
+DecayingBucketBuilder produces a BucketBuilder that yields DecayingBuckets
+with the given half-life.
+*/
+func DecayingBucketBuilder(halfLife time.Duration) BucketBuilder {
+	return func() Bucket {
+		return NewDecayingBucket(halfLife)
+	}
+}
+
+/*
+NewDecayingHistogram produces a Histogram backed by a single
+DecayingBucket with the given half-life, reporting the given percentiles.
+*/
+func NewDecayingHistogram(reportablePercentiles []float64, halfLife time.Duration) Histogram {
+	specification := &HistogramSpecification{
+		BucketBuilder:         DecayingBucketBuilder(halfLife),
+		ReportablePercentiles: reportablePercentiles,
+		Starts:                []float64{math.Inf(-1)},
+	}
+
+	return NewHistogram(specification)
+}
+
+/*
+decayFactor returns the fraction of a sample's weight as of timestamp that
+remains, as of now, under exp(-lambda*delta) with lambda = ln(2)/halfLife
+and delta the elapsed time.  It performs no mutation, so it is safe to
+call under a read lock; only decay, below, writes the result back.
+*/
+func (b *DecayingBucket) decayFactor(now, timestamp time.Time) float64 {
+	if b.halfLife <= 0 {
+		return 1
+	}
+
+	lambda := math.Ln2 / b.halfLife.Seconds()
+	delta := now.Sub(timestamp).Seconds()
+
+	return math.Exp(-lambda * delta)
+}
+
+/*
+decay multiplies every retained sample's weight by its decayFactor as of
+now and moves the sample's timestamp to now, so that the next decay only
+applies the time elapsed since this one.  It mutates b.samples, so callers must hold the histogram's write
+lock; Query, which runs under a read lock, must not call this and instead
+applies decayFactor without writing back.
+*/
+func (b *DecayingBucket) decay(now time.Time) {
+	for i := range b.samples {
+		b.samples[i].weight *= b.decayFactor(now, b.samples[i].timestamp)
+		b.samples[i].timestamp = now
+	}
+}
+
+func (b *DecayingBucket) Add(value float64) {
+	b.AddWithExemplar(value, nil)
+}
+
+/*
+AddWithExemplar decays existing samples, then inserts value, in sorted
+order, with a fresh weight of 1 and the given exemplar, evicting the
+lowest-weight sample if doing so would exceed maxSamples.
+*/
+func (b *DecayingBucket) AddWithExemplar(value float64, exemplarLabels map[string]string) {
+	now := time.Now()
+	b.decay(now)
+
+	i := sort.Search(len(b.samples), func(i int) bool { return b.samples[i].value >= value })
+
+	b.samples = append(b.samples, decayingSample{})
+	copy(b.samples[i+1:], b.samples[i:])
+	b.samples[i] = decayingSample{value: value, weight: 1, timestamp: now, exemplar: exemplarLabels}
+
+	if len(b.samples) > b.maxSamples {
+		b.evictLightest()
+	}
+}
+
+/*
+evictLightest drops the sample with the smallest decayed weight, i.e. the
+one contributing least to percentile queries.
+*/
+func (b *DecayingBucket) evictLightest() {
+	lightest := 0
+	for i, sample := range b.samples {
+		if sample.weight < b.samples[lightest].weight {
+			lightest = i
+		}
+	}
+
+	b.samples = append(b.samples[:lightest], b.samples[lightest+1:]...)
+}
+
+func (b *DecayingBucket) Observations() int {
+	return len(b.samples)
+}
+
+func (b *DecayingBucket) Reset() {
+	b.samples = nil
+}
+
+func (b *DecayingBucket) String() string {
+	return fmt.Sprintf("[DecayingBucket with %d samples]", len(b.samples))
+}
+
+/*
+ValueForIndex is provided to satisfy Bucket, but DecayingBucket is meant
+to be queried through Query; see the quantileQuerier short-circuit in
+histogram.percentile.
+*/
+func (b *DecayingBucket) ValueForIndex(index int) float64 {
+	if index < 0 || index >= len(b.samples) {
+		return 0
+	}
+
+	return b.samples[index].value
+}
+
+/*
+indexForPercentile returns the index, among the bucket's sorted samples,
+of the given percentile of the bucket's decay-weighted ranks rather than
+its raw observation counts.  Query and ExemplarForPercentile share this so
+that the value and exemplar reported for a percentile always refer to the
+same observation.
+
+indexForPercentile must not mutate the bucket: it runs under the
+histogram's outer read lock, which multiple goroutines may hold at once,
+so it computes each sample's current weight via decayFactor locally
+instead of calling decay.  Weights are only ever written back to samples
+by AddWithExemplar, under the write lock.
+*/
+func (b *DecayingBucket) indexForPercentile(percentile float64) int {
+	now := time.Now()
+
+	weights := make([]float64, len(b.samples))
+	totalWeight := 0.0
+	for i, sample := range b.samples {
+		weights[i] = sample.weight * b.decayFactor(now, sample.timestamp)
+		totalWeight += weights[i]
+	}
+
+	target := percentile * totalWeight
+	cumulative := 0.0
+	for i := range b.samples {
+		cumulative += weights[i]
+		if cumulative >= target {
+			return i
+		}
+	}
+
+	return len(b.samples) - 1
+}
+
+/*
+Query returns the value at the given percentile of the bucket's
+decay-weighted ranks rather than its raw observation counts.
+*/
+func (b *DecayingBucket) Query(percentile float64) float64 {
+	if len(b.samples) == 0 {
+		return 0
+	}
+
+	return b.samples[b.indexForPercentile(percentile)].value
+}
+
+/*
+ExemplarForPercentile returns the exemplar labels, if any, attached to the
+observation at the same decay-weighted percentile Query would answer, so
+that a caller can recover the exemplar behind a reported value through
+the quantileQuerier short-circuit; see the exemplarQuerier short-circuit
+in histogram.Exemplar.
+*/
+func (b *DecayingBucket) ExemplarForPercentile(percentile float64) map[string]string {
+	if len(b.samples) == 0 {
+		return nil
+	}
+
+	return b.samples[b.indexForPercentile(percentile)].exemplar
+}
+
+/*
+Exemplar returns the exemplar labels, if any, attached to the observation
+at the given index within the bucket's sorted samples.
+*/
+func (b *DecayingBucket) Exemplar(index int) map[string]string {
+	if index < 0 || index >= len(b.samples) {
+		return nil
+	}
+
+	return b.samples[index].exemplar
+}
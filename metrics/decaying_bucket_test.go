@@ -0,0 +1,122 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+/*
+TestDecayingHistogramConcurrentGatherDoesNotRace exercises AsMarshallable,
+EncodeText, and Gather concurrently against a DecayingHistogram under
+concurrent Add traffic.  Query (reached through each of those via the
+quantileQuerier short-circuit) runs under the histogram's read lock,
+which multiple goroutines may hold at once, so it must not mutate the
+bucket.  Run with -race to catch a regression.
+*/
+func TestDecayingHistogramConcurrentGatherDoesNotRace(t *testing.T) {
+	hist := NewDecayingHistogram([]float64{0.5, 0.9, 0.99}, time.Minute)
+	concrete := hist.(*histogram)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				hist.Add(nil, float64(i%1000))
+			}
+		}
+	}()
+
+	var readers sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for i := 0; i < 200; i++ {
+				hist.AsMarshallable()
+				var discard bytesDiscarder
+				concrete.EncodeText(discard, "decaying_test")
+				concrete.Gather("decaying_test")
+			}
+		}()
+	}
+
+	readers.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+type bytesDiscarder struct{}
+
+func (bytesDiscarder) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestDecayingBucketEvictsBeyondMaxSamples(t *testing.T) {
+	bucket := NewDecayingBucket(time.Minute)
+	bucket.maxSamples = 10
+
+	for i := 0; i < 1000; i++ {
+		bucket.Add(float64(i))
+	}
+
+	if observations := bucket.Observations(); observations > bucket.maxSamples {
+		t.Errorf("expected at most %d retained samples, got %d", bucket.maxSamples, observations)
+	}
+}
+
+func TestDecayingHistogramExemplarRoundTrips(t *testing.T) {
+	hist := NewDecayingHistogram([]float64{0.5}, time.Minute)
+
+	hist.AddWithExemplar(nil, 1, map[string]string{"traceID": "abc"})
+
+	if got := hist.Exemplar(nil, 0.5); got["traceID"] != "abc" {
+		t.Errorf("expected Exemplar to return the trace ID attached by AddWithExemplar, got %+v", got)
+	}
+}
+
+func TestDecayingHistogramExemplarNilWhenUnset(t *testing.T) {
+	hist := NewDecayingHistogram([]float64{0.5}, time.Minute)
+
+	hist.Add(nil, 1)
+
+	if got := hist.Exemplar(nil, 0.5); got != nil {
+		t.Errorf("expected no exemplar for an observation added without one, got %+v", got)
+	}
+
+	if got := hist.Exemplar(map[string]string{"missing": "signature"}, 0.5); got != nil {
+		t.Errorf("expected no exemplar for an unknown label signature, got %+v", got)
+	}
+}
+
+func TestDecayingBucketFavorsRecentObservations(t *testing.T) {
+	bucket := NewDecayingBucket(time.Millisecond)
+
+	bucket.Add(0)
+	// Let the first observation's weight decay toward zero relative to
+	// what follows.
+	time.Sleep(20 * time.Millisecond)
+
+	for i := 1; i <= 9; i++ {
+		bucket.Add(100)
+	}
+
+	// With old observations decayed away, the median should reflect the
+	// cluster of recent observations rather than the stale outlier.
+	if got := bucket.Query(0.5); got != 100 {
+		t.Errorf("expected decayed median near 100, got %v", got)
+	}
+}
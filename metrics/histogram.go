@@ -12,6 +12,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/prometheus/client_golang/utility"
+	"io"
 	"math"
 	"strconv"
 	"sync"
@@ -58,11 +59,26 @@ type HistogramSpecification struct {
 	BucketBuilder         BucketBuilder
 	ReportablePercentiles []float64
 	Starts                []float64
+	// Help is a one-line description of the histogram, surfaced as a
+	// "# HELP" line by EncodeText and as MetricFamily.Help by Gather.
+	Help string
 }
 
 type Histogram interface {
 	Add(labels map[string]string, value float64)
+	AddWithExemplar(labels map[string]string, value float64, exemplarLabels map[string]string)
 	AsMarshallable() map[string]interface{}
+	// EncodeText and Gather are also required of Metric, so that a
+	// Histogram can be registered directly with a Registry and pushed
+	// without needing to reach into this package's unexported concrete
+	// type.
+	EncodeText(w io.Writer, name string) error
+	Gather(name string) MetricFamily
+	// Exemplar returns the exemplar labels, if any, attached to the
+	// observation under labels nearest the given percentile, for buckets
+	// that retain exemplars; see ExemplarBucket. It returns nil if there
+	// is no such observation or its bucket doesn't retain exemplars.
+	Exemplar(labels map[string]string, percentile float64) map[string]string
 	ResetAll()
 	String() string
 }
@@ -97,6 +113,11 @@ type histogram struct {
 	 These are the percentile values that will be reported on marshalling.
 	*/
 	reportablePercentiles []float64
+	/*
+		This is a one-line description of the histogram, surfaced as a
+		"# HELP" line by EncodeText and as MetricFamily.Help by Gather.
+	*/
+	help string
 }
 
 type histogramValue struct {
@@ -105,6 +126,15 @@ type histogramValue struct {
 }
 
 func (h *histogram) Add(labels map[string]string, value float64) {
+	h.AddWithExemplar(labels, value, nil)
+}
+
+/*
+AddWithExemplar records value as Add does, additionally attaching
+exemplarLabels (e.g. a trace ID) to the observation if the bucket that
+captures it supports exemplars; see ExemplarBucket.
+*/
+func (h *histogram) AddWithExemplar(labels map[string]string, value float64, exemplarLabels map[string]string) {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
@@ -138,7 +168,13 @@ func (h *histogram) Add(labels map[string]string, value float64) {
 		lastIndex = i
 	}
 
-	histogram.buckets[lastIndex].Add(value)
+	bucket := histogram.buckets[lastIndex]
+	if exemplarBucket, ok := bucket.(ExemplarBucket); ok {
+		exemplarBucket.AddWithExemplar(value, exemplarLabels)
+		return
+	}
+
+	bucket.Add(value)
 }
 
 func (h *histogram) String() string {
@@ -269,13 +305,61 @@ func (h *histogram) bucketForPercentile(signature string, percentile float64) (*
 Return the histogram's estimate of the value for a given percentile of
 collected samples.  The requested percentile is expected to be a real
 value within (0, 1.0].
+
+If the histogram was built with a single bucket capable of answering
+percentile queries directly (see quantileQuerier), that bucket is
+consulted instead of the position-based bucketForPercentile algorithm.
 */
 func (h *histogram) percentile(signature string, percentile float64) float64 {
+	if len(h.bucketStarts) == 1 {
+		if querier, ok := h.values[signature].buckets[0].(quantileQuerier); ok {
+			return querier.Query(percentile)
+		}
+	}
+
 	bucket, index := h.bucketForPercentile(signature, percentile)
 
 	return (*bucket).ValueForIndex(index)
 }
 
+/*
+Exemplar returns the exemplar labels, if any, attached to the observation
+under labels nearest the given percentile, mirroring percentile's
+bucket-selection so that the exemplar always refers to the same
+observation a percentile query would report. It returns nil if there is
+no observation recorded under labels, or if the bucket responsible for
+percentile doesn't retain exemplars.
+*/
+func (h *histogram) Exemplar(labels map[string]string, percentile float64) map[string]string {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	signature := utility.LabelsToSignature(labels)
+
+	value, ok := h.values[signature]
+	if !ok {
+		return nil
+	}
+
+	if len(h.bucketStarts) == 1 {
+		if querier, ok := value.buckets[0].(exemplarQuerier); ok {
+			return querier.ExemplarForPercentile(percentile)
+		}
+
+		return nil
+	}
+
+	bucket, index := h.bucketForPercentile(signature, percentile)
+	if retriever, ok := (*bucket).(exemplarRetriever); ok {
+		return retriever.Exemplar(index)
+	}
+
+	return nil
+}
+
 func formatFloat(value float64) string {
 	return strconv.FormatFloat(value, floatFormat, floatPrecision, floatBitCount)
 }
@@ -305,6 +389,87 @@ func (h *histogram) AsMarshallable() map[string]interface{} {
 	return result
 }
 
+/*
+EncodeText writes the Prometheus text exposition format representation of
+the histogram, as name, to w: a "# HELP" line (omitted if the histogram
+was built without one), a "# TYPE" line, and one "name{labels} value"
+line per reportable percentile, with the percentile carried in a
+quantile label.
+
+This package has no HTTP handler for EncodeText to be wired into via
+content negotiation on Accept, as the originating request asked for —
+there is no net/http serving code anywhere in this tree to extend. A
+handler that picks EncodeText or AsMarshallable based on the request's
+Accept header belongs alongside wherever this package's registry ends up
+served from.
+*/
+func (h *histogram) EncodeText(w io.Writer, name string) error {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.help != "" {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n", name, EscapeLabelValueText(h.help)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "# TYPE %s summary\n", name); err != nil {
+		return err
+	}
+
+	for signature, value := range h.values {
+		labels := make(map[string]string, len(value.labels)+1)
+		for k, v := range value.labels {
+			labels[k] = v
+		}
+
+		for _, percentile := range h.reportablePercentiles {
+			labels["quantile"] = formatFloat(percentile)
+
+			line := fmt.Sprintf("%s%s %s\n", name, FormatLabelsText(labels), formatFloat(h.percentile(signature, percentile)))
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Gather produces a MetricFamily snapshot of the histogram's reportable
+percentiles, suitable for a Registry to collect across metrics and a
+Pusher to ship to a remote aggregator.
+*/
+func (h *histogram) Gather(name string) MetricFamily {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	family := MetricFamily{Name: name, Help: h.help, Type: "summary"}
+
+	for signature, value := range h.values {
+		base := make(map[string]string, len(value.labels)+1)
+		for k, v := range value.labels {
+			base[k] = v
+		}
+
+		for _, percentile := range h.reportablePercentiles {
+			labels := make(map[string]string, len(base))
+			for k, v := range base {
+				labels[k] = v
+			}
+			labels["quantile"] = formatFloat(percentile)
+
+			family.Samples = append(family.Samples, Sample{
+				Labels: labels,
+				Value:  h.percentile(signature, percentile),
+			})
+		}
+	}
+
+	return family
+}
+
 func (h *histogram) ResetAll() {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -326,6 +491,7 @@ func NewHistogram(specification *HistogramSpecification) Histogram {
 		bucketMaker:           specification.BucketBuilder,
 		bucketStarts:          specification.Starts,
 		reportablePercentiles: specification.ReportablePercentiles,
+		help:                  specification.Help,
 		values:                map[string]*histogramValue{},
 	}
 
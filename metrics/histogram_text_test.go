@@ -0,0 +1,62 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestHistogramEncodeTextIncludesHelpTypeAndSamples(t *testing.T) {
+	specification := &HistogramSpecification{
+		BucketBuilder:         AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+		Help:                  "Request latencies in seconds.",
+	}
+	hist := NewHistogram(specification)
+	hist.Add(map[string]string{"method": "GET"}, 1)
+	hist.Add(map[string]string{"method": "GET"}, 2)
+
+	buffer := &bytes.Buffer{}
+	if err := hist.(*histogram).EncodeText(buffer, "request_latency_seconds"); err != nil {
+		t.Fatalf("EncodeText returned an error: %v", err)
+	}
+
+	output := buffer.String()
+
+	if !strings.Contains(output, "# HELP request_latency_seconds Request latencies in seconds.\n") {
+		t.Errorf("expected a HELP line, got:\n%s", output)
+	}
+	if !strings.Contains(output, "# TYPE request_latency_seconds summary\n") {
+		t.Errorf("expected a TYPE line, got:\n%s", output)
+	}
+	if !strings.Contains(output, `method="GET"`) || !strings.Contains(output, `quantile="0.5"`) {
+		t.Errorf("expected a sample line carrying both the observation's and quantile labels, got:\n%s", output)
+	}
+}
+
+func TestHistogramEncodeTextOmitsHelpLineWhenUnset(t *testing.T) {
+	hist := NewHistogram(&HistogramSpecification{
+		BucketBuilder:         AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+	})
+	hist.Add(nil, 1)
+
+	buffer := &bytes.Buffer{}
+	if err := hist.(*histogram).EncodeText(buffer, "unhelped"); err != nil {
+		t.Fatalf("EncodeText returned an error: %v", err)
+	}
+
+	if strings.Contains(buffer.String(), "# HELP") {
+		t.Errorf("expected no HELP line when Help is unset, got:\n%s", buffer.String())
+	}
+}
@@ -6,10 +6,17 @@
 
 package metrics
 
+import "io"
+
 // A Metric is something that can be exposed via the registry framework.
 type Metric interface {
 	// Produce a JSON-consumable representation of the metric.
 	AsMarshallable() map[string]interface{}
+	// Write the Prometheus text exposition format representation of the
+	// metric, as name, to w.
+	EncodeText(w io.Writer, name string) error
+	// Gather a stable, typed snapshot of the metric's samples under name.
+	Gather(name string) MetricFamily
 	// Reset the parent metrics and delete all child metrics.
 	ResetAll()
 	// Produce a human-consumable representation of the metric.
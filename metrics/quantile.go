@@ -0,0 +1,286 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+/*
+A quantileTarget pairs a requested quantile with the relative error that
+callers are willing to tolerate in its estimate.
+*/
+type quantileTarget struct {
+	quantile float64
+	epsilon  float64
+}
+
+/*
+A ckmsSample is one tuple (v, g, delta) in the CKMS summary: an observed
+value, the count of observations between it and the previous tuple, and
+the maximum error in its rank.  g and delta are carried as float64,
+rather than the int the CKMS paper describes them as, purely so they can
+be compared against invariant's float64 result without repeated
+conversions.
+*/
+type ckmsSample struct {
+	value float64
+	g     float64
+	delta float64
+}
+
+/*
+A quantileQuerier is a Bucket that can answer percentile queries directly
+rather than through the position-based bucketForPercentile algorithm.
+Histograms built atop such a bucket short-circuit to Query.
+*/
+type quantileQuerier interface {
+	Query(percentile float64) float64
+}
+
+/*
+TargetedQuantileBucket is a Bucket implementing the Cormode-Korolova-
+Muthukrishnan biased quantiles algorithm.  Rather than bucketing values
+into caller-supplied ranges and picking a positional element, it keeps a
+compressed sketch of the full stream and answers Query(q) with bounded
+relative error for the (quantile, epsilon) pairs it was built with, using
+O(1/epsilon * log(epsilon*n)) memory.
+
+It is meant to be the sole bucket behind a Histogram; see
+NewSummaryHistogram.
+*/
+type TargetedQuantileBucket struct {
+	targets []quantileTarget
+	samples []ckmsSample
+	n       float64
+	inserts int
+}
+
+/*
+NewTargetedQuantileBucket constructs a bucket targeting the given
+(quantile, epsilon) pairs, e.g. {0.5: 0.05, 0.9: 0.01, 0.99: 0.001}.
+*/
+func NewTargetedQuantileBucket(targets map[float64]float64) *TargetedQuantileBucket {
+	bucketTargets := make([]quantileTarget, 0, len(targets))
+	for quantile, epsilon := range targets {
+		bucketTargets = append(bucketTargets, quantileTarget{quantile: quantile, epsilon: epsilon})
+	}
+
+	return &TargetedQuantileBucket{targets: bucketTargets}
+}
+
+/*
+TargetedQuantileBucketBuilder produces a BucketBuilder that yields
+TargetedQuantileBuckets targeting the given (quantile, epsilon) pairs.
+*/
+func TargetedQuantileBucketBuilder(targets map[float64]float64) BucketBuilder {
+	return func() Bucket {
+		return NewTargetedQuantileBucket(targets)
+	}
+}
+
+/*
+NewSummaryHistogram produces a Histogram backed by a single
+TargetedQuantileBucket targeting the given (quantile, epsilon) pairs, so
+callers get bounded relative-error percentiles without hand-tuning
+bucketStarts.
+*/
+func NewSummaryHistogram(targets map[float64]float64) Histogram {
+	percentiles := make([]float64, 0, len(targets))
+	for quantile := range targets {
+		percentiles = append(percentiles, quantile)
+	}
+	sort.Float64s(percentiles)
+
+	specification := &HistogramSpecification{
+		BucketBuilder:         TargetedQuantileBucketBuilder(targets),
+		ReportablePercentiles: percentiles,
+		Starts:                []float64{math.Inf(-1)},
+	}
+
+	return NewHistogram(specification)
+}
+
+/*
+invariant computes f(r, n), the minimum, over all targets, of the
+allowable error in rank r out of n observations.
+*/
+func (b *TargetedQuantileBucket) invariant(r float64) float64 {
+	min := math.MaxFloat64
+
+	for _, target := range b.targets {
+		var f float64
+		if target.quantile*b.n <= r {
+			f = (2 * target.epsilon * r) / target.quantile
+		} else {
+			f = (2 * target.epsilon * (b.n - r)) / (1 - target.quantile)
+		}
+		if f < min {
+			min = f
+		}
+	}
+
+	return min
+}
+
+/*
+rankBefore returns the cumulative rank of the observations preceding
+sample index i.
+*/
+func (b *TargetedQuantileBucket) rankBefore(i int) float64 {
+	rank := 0.0
+	for j := 0; j < i; j++ {
+		rank += b.samples[j].g
+	}
+
+	return rank
+}
+
+func (b *TargetedQuantileBucket) compressInterval() int {
+	minEpsilon := math.Inf(1)
+	for _, target := range b.targets {
+		if target.epsilon < minEpsilon {
+			minEpsilon = target.epsilon
+		}
+	}
+
+	if math.IsInf(minEpsilon, 1) || minEpsilon <= 0 {
+		return 1
+	}
+
+	interval := int(1 / (2 * minEpsilon))
+	if interval < 1 {
+		interval = 1
+	}
+
+	return interval
+}
+
+func (b *TargetedQuantileBucket) insert(value float64) {
+	i := sort.Search(len(b.samples), func(i int) bool { return b.samples[i].value >= value })
+
+	// Only the new minimum gets a zero-error delta; every other insertion
+	// (including a new maximum) carries the invariant's bound on the rank
+	// it lands at.
+	delta := 0.0
+	if i > 0 {
+		delta = math.Floor(b.invariant(b.rankBefore(i))) - 1
+		if delta < 0 {
+			delta = 0
+		}
+	}
+
+	b.samples = append(b.samples, ckmsSample{})
+	copy(b.samples[i+1:], b.samples[i:])
+	b.samples[i] = ckmsSample{value: value, g: 1, delta: delta}
+
+	b.n++
+	b.inserts++
+
+	if b.inserts >= b.compressInterval() {
+		b.compress()
+		b.inserts = 0
+	}
+}
+
+/*
+compress merges tuples from right to left into the rightmost tuple that
+still satisfies the rank-error invariant, bounding the sketch's size.
+Unlike naively merging fixed neighbor pairs, the surviving "kept" tuple
+(x) is carried across iterations so a run of mergeable tuples collapses
+into one rather than only ever merging into its immediate successor.
+*/
+func (b *TargetedQuantileBucket) compress() {
+	if len(b.samples) < 2 {
+		return
+	}
+
+	x := b.samples[len(b.samples)-1]
+	xi := len(b.samples) - 1
+	rank := b.n - x.g
+
+	for i := len(b.samples) - 2; i >= 0; i-- {
+		current := b.samples[i]
+
+		if current.g+x.g+x.delta <= b.invariant(rank) {
+			x.g += current.g
+			b.samples[xi] = x
+			b.samples = append(b.samples[:i], b.samples[i+1:]...)
+			xi--
+		} else {
+			x = current
+			xi = i
+		}
+
+		rank -= current.g
+	}
+}
+
+func (b *TargetedQuantileBucket) Add(value float64) {
+	b.insert(value)
+}
+
+func (b *TargetedQuantileBucket) Observations() int {
+	return int(b.n)
+}
+
+func (b *TargetedQuantileBucket) Reset() {
+	b.samples = nil
+	b.n = 0
+	b.inserts = 0
+}
+
+func (b *TargetedQuantileBucket) String() string {
+	return fmt.Sprintf("[TargetedQuantileBucket with %d observations in %d samples]", int(b.n), len(b.samples))
+}
+
+/*
+ValueForIndex is provided to satisfy Bucket, but TargetedQuantileBucket is
+meant to be queried through Query; see the quantileQuerier short-circuit
+in histogram.percentile.
+*/
+func (b *TargetedQuantileBucket) ValueForIndex(index int) float64 {
+	if index < 0 || index >= len(b.samples) {
+		return 0
+	}
+
+	return b.samples[index].value
+}
+
+/*
+Query returns the estimated value at the given quantile, bounded by the
+error this bucket was constructed to tolerate for it.  It walks the
+sketch tracking, in rank, the rightmost tuple not yet returned (previous)
+and returns that tuple's value as soon as admitting the next one would
+overshoot the target rank by more than the invariant allows — mirroring
+the CKMS paper's query procedure rather than comparing a running total
+against the target directly.
+*/
+func (b *TargetedQuantileBucket) Query(percentile float64) float64 {
+	if len(b.samples) == 0 {
+		return 0
+	}
+
+	target := math.Ceil(percentile * b.n)
+	target += math.Ceil(b.invariant(target) / 2)
+
+	previous := b.samples[0]
+	rank := 0.0
+	for _, sample := range b.samples[1:] {
+		rank += previous.g
+		if rank+sample.g+sample.delta > target {
+			return previous.value
+		}
+		previous = sample
+	}
+
+	return previous.value
+}
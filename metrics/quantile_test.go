@@ -0,0 +1,93 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+/*
+rankFraction returns the fraction of sorted's elements strictly less than
+value, i.e. where value would rank were it inserted into sorted.
+*/
+func rankFraction(sorted []float64, value float64) float64 {
+	return float64(sort.SearchFloat64s(sorted, value)) / float64(len(sorted))
+}
+
+func TestTargetedQuantileBucketBoundedError(t *testing.T) {
+	targets := map[float64]float64{
+		0.5:  0.01,
+		0.9:  0.01,
+		0.99: 0.001,
+	}
+
+	bucket := NewTargetedQuantileBucket(targets)
+
+	random := rand.New(rand.NewSource(1))
+	n := 100000
+	values := make([]float64, 0, n)
+	for i := 0; i < n; i++ {
+		value := random.Float64() * 1000
+		values = append(values, value)
+		bucket.Add(value)
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	for quantile, epsilon := range targets {
+		got := bucket.Query(quantile)
+		rank := rankFraction(sorted, got)
+
+		// Allow a little slack over the nominal epsilon: the bound is on
+		// rank error, the tolerance here is on the quantile scale directly,
+		// and rounding in a finite sketch costs a few extra observations.
+		if diff := rank - quantile; diff > epsilon*2 || diff < -epsilon*2 {
+			t.Errorf("quantile %v: rank fraction %v outside of +/-%v of target (epsilon %v)", quantile, rank, epsilon*2, epsilon)
+		}
+	}
+}
+
+func TestTargetedQuantileBucketObservationsAndReset(t *testing.T) {
+	bucket := NewTargetedQuantileBucket(map[float64]float64{0.5: 0.01})
+
+	for i := 0; i < 10; i++ {
+		bucket.Add(float64(i))
+	}
+
+	if observations := bucket.Observations(); observations != 10 {
+		t.Errorf("expected 10 observations, got %d", observations)
+	}
+
+	bucket.Reset()
+
+	if observations := bucket.Observations(); observations != 0 {
+		t.Errorf("expected 0 observations after Reset, got %d", observations)
+	}
+
+	if got := bucket.Query(0.5); got != 0 {
+		t.Errorf("expected Query to return 0 on an empty bucket, got %v", got)
+	}
+}
+
+func TestNewSummaryHistogram(t *testing.T) {
+	histogram := NewSummaryHistogram(map[float64]float64{0.5: 0.05, 0.9: 0.01})
+
+	for i := 1; i <= 100; i++ {
+		histogram.Add(nil, float64(i))
+	}
+
+	marshalled := histogram.AsMarshallable()
+	values, ok := marshalled[valueKey].([]map[string]interface{})
+	if !ok || len(values) != 1 {
+		t.Fatalf("expected exactly one label set in %v", marshalled)
+	}
+}
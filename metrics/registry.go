@@ -0,0 +1,108 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+/*
+A Sample is one observation within a MetricFamily, along with the labels
+that identify its series.  For a Histogram, Labels carries a "quantile"
+entry alongside whatever labels the observation itself was recorded
+under.
+*/
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+/*
+A MetricFamily is a named, typed collection of Samples gathered from a
+single registered Metric.  It is the stable, serialization-agnostic
+snapshot produced by Registry.Gather, from which callers can build their
+own JSON, text, or other encodings.
+*/
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+/*
+A Registry collects Metrics under a name so that a short-lived job can
+snapshot all of them at once, e.g. to ship to a remote aggregator via the
+push subpackage, rather than only marshalling one metric at a time.
+*/
+type Registry interface {
+	// Add registers metric under name. It is an error to Add under a name
+	// that is already registered; use Replace to overwrite.
+	Add(name string, metric Metric) error
+	// Replace registers metric under name, overwriting whatever was
+	// previously registered under it, if anything.
+	Replace(name string, metric Metric)
+	// Gather snapshots every registered Metric into a MetricFamily, sorted
+	// by name for stable output.
+	Gather() []MetricFamily
+}
+
+type registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]Metric
+}
+
+/*
+NewRegistry produces an empty, ready-to-use Registry.
+*/
+func NewRegistry() Registry {
+	return &registry{
+		metrics: map[string]Metric{},
+	}
+}
+
+func (r *registry) Add(name string, metric Metric) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.metrics[name]; ok {
+		return fmt.Errorf("metrics: %s is already registered", name)
+	}
+
+	r.metrics[name] = metric
+
+	return nil
+}
+
+func (r *registry) Replace(name string, metric Metric) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.metrics[name] = metric
+}
+
+func (r *registry) Gather() []MetricFamily {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make([]MetricFamily, 0, len(names))
+	for _, name := range names {
+		families = append(families, r.metrics[name].Gather(name))
+	}
+
+	return families
+}
@@ -0,0 +1,85 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import "testing"
+
+func TestRegistryGatherOrdersByNameAndCarriesHelp(t *testing.T) {
+	registry := NewRegistry()
+
+	zebra := NewHistogram(&HistogramSpecification{
+		BucketBuilder:         AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+		Help:                  "Zebra help.",
+	})
+	zebra.Add(map[string]string{"kind": "stripe"}, 1)
+
+	apple := NewHistogram(&HistogramSpecification{
+		BucketBuilder:         AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+		Help:                  "Apple help.",
+	})
+	apple.Add(map[string]string{"kind": "fruit"}, 2)
+
+	if err := registry.Add("zebra", zebra); err != nil {
+		t.Fatalf("Add(zebra) returned an error: %v", err)
+	}
+	if err := registry.Add("apple", apple); err != nil {
+		t.Fatalf("Add(apple) returned an error: %v", err)
+	}
+
+	families := registry.Gather()
+	if len(families) != 2 {
+		t.Fatalf("expected 2 families, got %d", len(families))
+	}
+
+	if families[0].Name != "apple" || families[1].Name != "zebra" {
+		t.Errorf("expected families sorted by name [apple, zebra], got [%s, %s]", families[0].Name, families[1].Name)
+	}
+
+	if families[0].Help != "Apple help." {
+		t.Errorf("expected apple family to carry its Help, got %q", families[0].Help)
+	}
+	if families[0].Type != "summary" {
+		t.Errorf("expected apple family Type %q, got %q", "summary", families[0].Type)
+	}
+
+	found := false
+	for _, sample := range families[0].Samples {
+		if sample.Labels["kind"] == "fruit" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected a sample carrying the kind=fruit label, got %+v", families[0].Samples)
+	}
+}
+
+func TestRegistryAddRejectsDuplicateName(t *testing.T) {
+	registry := NewRegistry()
+	metric := NewHistogram(&HistogramSpecification{
+		BucketBuilder:         AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+	})
+
+	if err := registry.Add("dup", metric); err != nil {
+		t.Fatalf("first Add returned an error: %v", err)
+	}
+	if err := registry.Add("dup", metric); err == nil {
+		t.Errorf("expected second Add under the same name to return an error")
+	}
+
+	registry.Replace("dup", metric)
+	if families := registry.Gather(); len(families) != 1 {
+		t.Errorf("expected Replace to keep a single family registered, got %d", len(families))
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+FormatLabelsText renders labels as the brace-delimited, comma-separated
+"name=\"value\"" list expected after a metric name in the text exposition
+format, with keys sorted for stable output.  It is exported so that other
+packages emitting this format, such as push, can share this
+implementation rather than forking their own.
+*/
+func FormatLabelsText(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", key, EscapeLabelValueText(labels[key])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelValueTextEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+/*
+EscapeLabelValueText escapes backslashes, double quotes, and newlines, as
+required of label values in the text exposition format.
+*/
+func EscapeLabelValueText(value string) string {
+	return labelValueTextEscaper.Replace(value)
+}
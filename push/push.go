@@ -0,0 +1,167 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+// Package push ships a Registry's gathered metrics to a push gateway, so
+// that short-lived, cron-style jobs can report metrics without running
+// their own HTTP server.
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/metrics"
+)
+
+/*
+A Pusher ships a Registry's gathered metrics to a push gateway under a
+job name and an optional set of grouping labels (e.g. "instance") that
+further disambiguate the push.
+*/
+type Pusher struct {
+	URL            string
+	JobName        string
+	GroupingLabels map[string]string
+	Registry       metrics.Registry
+}
+
+/*
+NewPusher builds a Pusher for the given push gateway URL, job name, and
+registry.  GroupingLabels may be set on the returned Pusher afterward.
+*/
+func NewPusher(url, jobName string, registry metrics.Registry) *Pusher {
+	return &Pusher{
+		URL:      url,
+		JobName:  jobName,
+		Registry: registry,
+	}
+}
+
+/*
+Push PUTs the Pusher's registry to its push gateway URL, replacing
+whatever was previously pushed under this job and grouping.
+*/
+func (p *Pusher) Push() error {
+	return p.pushText(http.MethodPut)
+}
+
+/*
+Add POSTs the Pusher's registry to its push gateway URL, augmenting
+whatever was previously pushed under this job and grouping rather than
+replacing it.
+*/
+func (p *Pusher) Add() error {
+	return p.pushText(http.MethodPost)
+}
+
+/*
+PushJSON behaves like Push, but serializes the gathered families as JSON
+rather than the text exposition format.
+*/
+func (p *Pusher) PushJSON() error {
+	return p.pushJSON(http.MethodPut)
+}
+
+func (p *Pusher) pushText(method string) error {
+	body := &bytes.Buffer{}
+
+	for _, family := range p.Registry.Gather() {
+		if err := encodeFamilyText(body, family); err != nil {
+			return err
+		}
+	}
+
+	return p.do(method, "text/plain; version=0.0.4", body.Bytes())
+}
+
+func (p *Pusher) pushJSON(method string) error {
+	body, err := json.Marshal(p.Registry.Gather())
+	if err != nil {
+		return err
+	}
+
+	return p.do(method, "application/json", body)
+}
+
+func (p *Pusher) do(method, contentType string, body []byte) error {
+	request, err := http.NewRequest(method, p.groupedURL(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// Drain the body so the connection can be reused by the transport's
+	// keep-alive pool, even though we don't care about its contents.
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("push: unexpected status %s", response.Status)
+	}
+
+	return nil
+}
+
+func (p *Pusher) groupedURL() string {
+	path := fmt.Sprintf("/job/%s", url.PathEscape(p.JobName))
+
+	labels := make([]string, 0, len(p.GroupingLabels))
+	for label := range p.GroupingLabels {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		path = fmt.Sprintf("%s/%s/%s", path, url.PathEscape(label), url.PathEscape(p.GroupingLabels[label]))
+	}
+
+	return strings.TrimRight(p.URL, "/") + path
+}
+
+/*
+ToURL gathers registry and PUTs it, text-encoded, to url under jobName
+and groupingLabels — a convenience for one-off pushes that don't need a
+persistent Pusher.
+*/
+func ToURL(url, jobName string, groupingLabels map[string]string, registry metrics.Registry) error {
+	pusher := NewPusher(url, jobName, registry)
+	pusher.GroupingLabels = groupingLabels
+
+	return pusher.Push()
+}
+
+func encodeFamilyText(w *bytes.Buffer, family metrics.MetricFamily) error {
+	if family.Help != "" {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n", family.Name, metrics.EscapeLabelValueText(family.Help)); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", family.Name, family.Type); err != nil {
+		return err
+	}
+
+	for _, sample := range family.Samples {
+		value := strconv.FormatFloat(sample.Value, 'g', -1, 64)
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", family.Name, metrics.FormatLabelsText(sample.Labels), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package push
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/metrics"
+)
+
+func newTestRegistry(t *testing.T) metrics.Registry {
+	t.Helper()
+
+	hist := metrics.NewHistogram(&metrics.HistogramSpecification{
+		BucketBuilder:         metrics.AccumulatingBucketBuilder(),
+		ReportablePercentiles: []float64{0.5},
+		Starts:                []float64{0},
+		Help:                  `Quoted "help" with a backslash \.`,
+	})
+	hist.Add(map[string]string{"path": `/a"b`}, 1)
+
+	registry := metrics.NewRegistry()
+	if err := registry.Add("request_latency", hist); err != nil {
+		t.Fatalf("registry.Add returned an error: %v", err)
+	}
+
+	return registry
+}
+
+func TestPusherPushSendsEscapedText(t *testing.T) {
+	var method string
+	var contentType string
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "myjob", newTestRegistry(t))
+	if err := pusher.Push(); err != nil {
+		t.Fatalf("Push returned an error: %v", err)
+	}
+
+	if method != http.MethodPut {
+		t.Errorf("expected Push to PUT, got %s", method)
+	}
+	if !strings.Contains(contentType, "text/plain") {
+		t.Errorf("expected a text/plain content type, got %q", contentType)
+	}
+
+	text := string(body)
+	if !strings.Contains(text, `# HELP request_latency Quoted \"help\" with a backslash \\.`+"\n") {
+		t.Errorf("expected an escaped HELP line, got:\n%s", text)
+	}
+	if !strings.Contains(text, "# TYPE request_latency summary\n") {
+		t.Errorf("expected a TYPE line, got:\n%s", text)
+	}
+	if !strings.Contains(text, `path="/a\"b"`) {
+		t.Errorf("expected an escaped label value, got:\n%s", text)
+	}
+}
+
+func TestPusherAddPOSTs(t *testing.T) {
+	var method string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "myjob", newTestRegistry(t))
+	if err := pusher.Add(); err != nil {
+		t.Fatalf("Add returned an error: %v", err)
+	}
+
+	if method != http.MethodPost {
+		t.Errorf("expected Add to POST, got %s", method)
+	}
+}
+
+func TestPusherPushJSONSendsFamilies(t *testing.T) {
+	var contentType string
+	var body []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	pusher := NewPusher(server.URL, "myjob", newTestRegistry(t))
+	if err := pusher.PushJSON(); err != nil {
+		t.Fatalf("PushJSON returned an error: %v", err)
+	}
+
+	if !strings.Contains(contentType, "application/json") {
+		t.Errorf("expected an application/json content type, got %q", contentType)
+	}
+
+	var families []metrics.MetricFamily
+	if err := json.Unmarshal(body, &families); err != nil {
+		t.Fatalf("failed to unmarshal pushed JSON: %v", err)
+	}
+	if len(families) != 1 || families[0].Name != "request_latency" {
+		t.Fatalf("expected a single request_latency family, got %+v", families)
+	}
+	if families[0].Help == "" {
+		t.Errorf("expected the pushed family to carry its Help")
+	}
+}
+
+func TestPusherGroupedURLIncludesJobAndSortedLabels(t *testing.T) {
+	pusher := NewPusher("http://example.org/", "myjob", newTestRegistry(t))
+	pusher.GroupingLabels = map[string]string{"instance": "a", "zone": "b"}
+
+	got := pusher.groupedURL()
+	want := "http://example.org/job/myjob/instance/a/zone/b"
+	if got != want {
+		t.Errorf("groupedURL() = %q, want %q", got, want)
+	}
+}
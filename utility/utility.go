@@ -0,0 +1,41 @@
+/*
+Copyright (c) 2012, Matt T. Proud
+All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+package utility
+
+import (
+	"bytes"
+	"sort"
+)
+
+/*
+LabelsToSignature produces a stable string signature for a label set,
+suitable for use as a map key to group observations sharing the same
+labels regardless of the order they were supplied in.
+*/
+func LabelsToSignature(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buffer := &bytes.Buffer{}
+	for _, name := range names {
+		buffer.WriteString(name)
+		buffer.WriteString("=")
+		buffer.WriteString(labels[name])
+		buffer.WriteString(";")
+	}
+
+	return buffer.String()
+}